@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -11,11 +14,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes"
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/openshift/installer/pkg/asset"
@@ -25,8 +25,26 @@ import (
 	"github.com/openshift/installer/pkg/asset/installconfig"
 	"github.com/openshift/installer/pkg/asset/kubeconfig"
 	"github.com/openshift/installer/pkg/asset/manifests"
+	"github.com/openshift/installer/pkg/asset/manifests/mirror"
+	"github.com/openshift/installer/pkg/asset/manifests/proxy"
 	"github.com/openshift/installer/pkg/asset/templates"
+	"github.com/openshift/installer/pkg/bootstrap/waiter"
 	destroybootstrap "github.com/openshift/installer/pkg/destroy/bootstrap"
+	"github.com/openshift/installer/pkg/infrastructure/clusterapi"
+)
+
+// infrastructureBackend selects how `create cluster` provisions the
+// underlying infrastructure: the default "terraform" backend, or the
+// experimental "capi" (Cluster API) backend. The capi backend is
+// unsupported: clusterapi.New refuses to start unless the operator has
+// already vendored the Cluster API core and provider CRDs under
+// <install dir>/.clusterapi_output/crd by hand, so the flag is hidden
+// from --help rather than advertised as a ready-to-use alternative.
+var infrastructureBackend string
+
+const (
+	infrastructureTerraform = "terraform"
+	infrastructureCAPI      = "capi"
 )
 
 type target struct {
@@ -57,7 +75,7 @@ var (
 			// FIXME: add longer descriptions for our commands with examples for better UX.
 			// Long:  "",
 		},
-		assets: []asset.WritableAsset{&manifests.Manifests{}, &manifests.Openshift{}},
+		assets: []asset.WritableAsset{&manifests.Manifests{}, &manifests.Openshift{}, &proxy.Proxy{}},
 	}
 
 	manifestTemplatesTarget = target{
@@ -70,6 +88,17 @@ var (
 		assets: []asset.WritableAsset{&templates.Templates{}},
 	}
 
+	mirrorConfigTarget = target{
+		name: "Mirror Registry Config",
+		command: &cobra.Command{
+			Use:   "mirror-config",
+			Short: "Generates the mirror registry manifests",
+			// FIXME: add longer descriptions for our commands with examples for better UX.
+			// Long:  "",
+		},
+		assets: []asset.WritableAsset{&mirror.MirrorConfig{}},
+	}
+
 	ignitionConfigsTarget = target{
 		name: "Ignition Configs",
 		command: &cobra.Command{
@@ -99,7 +128,7 @@ var (
 		assets: []asset.WritableAsset{&cluster.TerraformVariables{}, &kubeconfig.Admin{}, &cluster.Cluster{}},
 	}
 
-	targets = []target{installConfigTarget, manifestTemplatesTarget, manifestsTarget, ignitionConfigsTarget, clusterTarget}
+	targets = []target{installConfigTarget, manifestTemplatesTarget, manifestsTarget, mirrorConfigTarget, ignitionConfigsTarget, clusterTarget}
 )
 
 func newCreateCmd() *cobra.Command {
@@ -116,9 +145,78 @@ func newCreateCmd() *cobra.Command {
 		cmd.AddCommand(t.command)
 	}
 
+	clusterTarget.command.Flags().StringVar(&infrastructureBackend, "infrastructure", infrastructureTerraform,
+		fmt.Sprintf("infrastructure backend to provision the cluster with (%s or %s); %s requires the Cluster API core and provider CRDs to already be vendored under <dir>/%s/crd and is unsupported",
+			infrastructureTerraform, infrastructureCAPI, infrastructureCAPI, clusterapi.StateDir))
+	// Unsupported and not ready for general use: hide it from --help rather
+	// than advertise a path that always fails until CRDs are vendored by
+	// hand. The flag itself still works for whoever already knows about it.
+	if err := clusterTarget.command.Flags().MarkHidden("infrastructure"); err != nil {
+		panic(err)
+	}
+	clusterTarget.command.Flags().StringVar(&notifyWebhookURL, "notify-webhook", "",
+		"URL to POST a JSON notification to at each install stage transition (api-up, bootstrap-complete, operators-ready, bootstrap-destroyed, install-complete)")
+	clusterTarget.command.RunE = runClusterCmd
+
+	cmd.AddCommand(newSnapshotCmd())
+	cmd.AddCommand(newRestoreCmd())
+
 	return cmd
 }
 
+// runClusterCmd dispatches to the Terraform-driven asset pipeline or, when
+// --infrastructure=capi is given, to the Cluster API driven path.
+func runClusterCmd(cmd *cobra.Command, args []string) error {
+	if infrastructureBackend == infrastructureCAPI {
+		return runClusterCAPICmd(cmd, args)
+	}
+	return runTargetCmd(clusterTarget.assets...)(cmd, args)
+}
+
+// runClusterCAPICmd provisions the cluster's infrastructure with an
+// in-process Cluster API management cluster instead of Terraform. It still
+// reuses the InstallConfig asset and the existing destroyBootstrap flow.
+func runClusterCAPICmd(cmd *cobra.Command, _ []string) error {
+	cleanup, err := setupFileHook(rootOpts.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to setup logging hook")
+	}
+	defer cleanup()
+
+	assetStore, err := asset.NewStore(rootOpts.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to create asset store")
+	}
+
+	installConfig := &installconfig.InstallConfig{}
+	if err := assetStore.Fetch(installConfig); err != nil {
+		return errors.Wrap(err, "failed to fetch install config")
+	}
+
+	ctx := context.Background()
+	provisioner, err := clusterapi.New(ctx, rootOpts.dir, installConfig.Config)
+	if err != nil {
+		return errors.Wrap(err, "failed to start cluster-api management cluster")
+	}
+	defer provisioner.Close()
+
+	if err := provisioner.Apply(ctx); err != nil {
+		return errors.Wrap(err, "failed to apply cluster-api manifests")
+	}
+
+	if err := provisioner.WaitForInfrastructure(ctx); err != nil {
+		return errors.Wrap(err, "failed waiting for cluster-api infrastructure")
+	}
+
+	if err := provisioner.WriteKubeconfig(ctx); err != nil {
+		return errors.Wrap(err, "failed to write kubeconfig")
+	}
+
+	// destroyBootstrap (and logComplete) run via clusterTarget's PostRunE,
+	// same as the Terraform-driven path.
+	return nil
+}
+
 func runTargetCmd(targets ...asset.WritableAsset) func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		cleanup, err := setupFileHook(rootOpts.dir)
@@ -158,6 +256,71 @@ func runTargetCmd(targets ...asset.WritableAsset) func(cmd *cobra.Command, args
 	}
 }
 
+// applyProxy sets config's Proxy func to route through the cluster-wide
+// proxy, if one was set in the install config, so that the clients the
+// waiter builds from config can reach the API the same way the bootstrap
+// and cluster nodes do.
+func applyProxy(config *rest.Config, directory string) {
+	assetStore, err := asset.NewStore(directory)
+	if err != nil {
+		logrus.Debugf("failed to load asset store for proxy settings: %v", err)
+		return
+	}
+
+	installConfig := &installconfig.InstallConfig{}
+	if err := assetStore.Fetch(installConfig); err != nil || installConfig.Config.Proxy == nil {
+		return
+	}
+
+	proxyConfig := &httpproxy.Config{
+		HTTPProxy:  installConfig.Config.Proxy.HTTPProxy,
+		HTTPSProxy: installConfig.Config.Proxy.HTTPSProxy,
+		NoProxy:    installConfig.Config.Proxy.NoProxy,
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	config.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// checkProxyReadiness probes the install config's Proxy.ReadinessEndpoints
+// (if any were configured) through the proxy config applyProxy just set up,
+// so a proxy that can't actually reach those endpoints is caught here
+// instead of failing deep into bootstrapping.
+func checkProxyReadiness(config *rest.Config, directory string) error {
+	assetStore, err := asset.NewStore(directory)
+	if err != nil {
+		logrus.Debugf("failed to load asset store for proxy readiness check: %v", err)
+		return nil
+	}
+
+	installConfig := &installconfig.InstallConfig{}
+	if err := assetStore.Fetch(installConfig); err != nil || installConfig.Config.Proxy == nil {
+		return nil
+	}
+
+	endpoints := installConfig.Config.Proxy.ReadinessEndpoints
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: config.Proxy},
+		Timeout:   10 * time.Second,
+	}
+
+	for _, endpoint := range endpoints {
+		logrus.Infof("Checking proxy readiness against %s...", endpoint)
+		resp, err := client.Get(endpoint)
+		if err != nil {
+			return errors.Wrapf(err, "failed to reach %s through the proxy", endpoint)
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
 // FIXME: pulling the kubeconfig and metadata out of the root
 // directory is a bit cludgy when we already have them in memory.
 func destroyBootstrap(ctx context.Context, directory string) (err error) {
@@ -171,95 +334,52 @@ func destroyBootstrap(ctx context.Context, directory string) (err error) {
 	if err != nil {
 		return errors.Wrap(err, "loading kubeconfig")
 	}
+	applyProxy(config, directory)
 
-	client, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return errors.Wrap(err, "creating a Kubernetes client")
-	}
-
-	discovery := client.Discovery()
-
-	apiTimeout := 30 * time.Minute
-	logrus.Infof("Waiting %v for the Kubernetes API...", apiTimeout)
-	apiContext, cancel := context.WithTimeout(ctx, apiTimeout)
-	defer cancel()
-	// Poll quickly so we notice changes, but only log when the response
-	// changes (because that's interesting) or when we've seen 15 of the
-	// same errors in a row (to show we're still alive).
-	logDownsample := 15
-	silenceRemaining := logDownsample
-	previousErrorSuffix := ""
-	wait.Until(func() {
-		version, err := discovery.ServerVersion()
-		if err == nil {
-			logrus.Infof("API %s up", version)
-			cancel()
-		} else {
-			silenceRemaining--
-			chunks := strings.Split(err.Error(), ":")
-			errorSuffix := chunks[len(chunks)-1]
-			if previousErrorSuffix != errorSuffix {
-				logrus.Debugf("Still waiting for the Kubernetes API: %v", err)
-				previousErrorSuffix = errorSuffix
-				silenceRemaining = logDownsample
-			} else if silenceRemaining == 0 {
-				logrus.Debugf("Still waiting for the Kubernetes API: %v", err)
-				silenceRemaining = logDownsample
-			}
-		}
-	}, 2*time.Second, apiContext.Done())
-
-	events := client.CoreV1().Events("kube-system")
-
-	eventTimeout := 30 * time.Minute
-	logrus.Infof("Waiting %v for the bootstrap-complete event...", eventTimeout)
-	eventContext, cancel := context.WithTimeout(ctx, eventTimeout)
-	defer cancel()
-	_, err = Until(
-		eventContext,
-		"",
-		func(sinceResourceVersion string) (watch.Interface, error) {
-			for {
-				watcher, err := events.Watch(metav1.ListOptions{
-					ResourceVersion: sinceResourceVersion,
-				})
-				if err == nil {
-					return watcher, nil
-				}
-				select {
-				case <-eventContext.Done():
-					return watcher, err
-				default:
-					logrus.Warningf("Failed to connect events watcher: %s", err)
-					time.Sleep(2 * time.Second)
-				}
-			}
-		},
-		func(watchEvent watch.Event) (bool, error) {
-			event, ok := watchEvent.Object.(*corev1.Event)
-			if !ok {
-				return false, nil
-			}
+	if err := checkProxyReadiness(config, directory); err != nil {
+		return errors.Wrap(err, "checking proxy readiness")
+	}
 
-			if watchEvent.Type == watch.Error {
-				logrus.Debugf("error %s: %s", event.Name, event.Message)
-				return false, nil
-			}
+	clusterID := clusterIDFromMetadata(directory)
+	w := waiter.New()
 
-			if watchEvent.Type != watch.Added {
-				return false, nil
-			}
+	if err := w.WaitForAPI(ctx, config); err != nil {
+		return errors.Wrap(err, "waiting for the Kubernetes API")
+	}
+	notifyWebhook(ctx, "api-up", clusterID, "Kubernetes API is up")
 
-			logrus.Debugf("added %s: %s", event.Name, event.Message)
-			return event.Name == "bootstrap-complete", nil
-		},
-	)
-	if err != nil {
+	if err := w.WaitForBootstrapComplete(ctx, config); err != nil {
 		return errors.Wrap(err, "waiting for bootstrap-complete")
 	}
+	notifyWebhook(ctx, "bootstrap-complete", clusterID, "Bootstrap complete")
+
+	if err := w.WaitForClusterOperators(ctx, config); err != nil {
+		return errors.Wrap(err, "waiting for cluster operators")
+	}
+	notifyWebhook(ctx, "operators-ready", clusterID, "All cluster operators are ready")
 
 	logrus.Info("Destroying the bootstrap resources...")
-	return destroybootstrap.Destroy(rootOpts.dir)
+	if err := destroybootstrap.Destroy(rootOpts.dir); err != nil {
+		return err
+	}
+	notifyWebhook(ctx, "bootstrap-destroyed", clusterID, "Bootstrap resources destroyed")
+
+	return nil
+}
+
+// clusterIDFromMetadata is best-effort: a missing or unreadable metadata
+// file must not prevent the install from proceeding, so it just yields an
+// empty clusterID for the webhook payload.
+func clusterIDFromMetadata(directory string) string {
+	assetStore, err := asset.NewStore(directory)
+	if err != nil {
+		return ""
+	}
+	installConfig := &installconfig.InstallConfig{}
+	if err := assetStore.Fetch(installConfig); err != nil {
+		return ""
+	}
+	return installConfig.Config.ClusterID
 }
 
 // logComplete prints info upon completion
@@ -276,5 +396,6 @@ func logComplete(directory string) error {
 	}
 	logrus.Infof("kubeadmin user password: %s", pw)
 	logrus.Infof("Install complete! The kubeconfig is located here: %s", kubeconfig)
+	notifyWebhook(context.Background(), "install-complete", clusterIDFromMetadata(directory), "Install complete")
 	return nil
 }
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ephemeralResources are excluded from a snapshot because they are
+// regenerated by the control plane and carry no state worth restoring.
+var ephemeralResources = map[string]bool{
+	"events":         true,
+	"endpoints":      true,
+	"endpointslices": true,
+	"pods":           true,
+}
+
+// snapshotOutFile, restoreSnapshot and restoreTargetDir hold the flags for
+// `create snapshot` and `restore`, mirroring how rootOpts holds --dir for the
+// rest of the CLI.
+var (
+	snapshotOutFile  string
+	restoreSnapshot  string
+	restoreTargetDir string
+)
+
+func newSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Capture cluster and etcd state for disaster-recovery testing",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshot(context.Background(), rootOpts.dir, snapshotOutFile)
+		},
+	}
+	cmd.Flags().StringVar(&snapshotOutFile, "out", "snapshot.tar.gz", "path to write the snapshot archive to")
+	return cmd
+}
+
+// newRestoreCmd returns the `restore` command, registered as `create
+// restore` alongside `create snapshot` in newCreateCmd.
+func newRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Recreate an install directory and bootstrap node from a snapshot",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRestore(context.Background(), restoreSnapshot, restoreTargetDir)
+		},
+	}
+	cmd.Flags().StringVar(&restoreSnapshot, "snapshot", "", "path to the snapshot archive produced by `create snapshot`")
+	cmd.Flags().StringVar(&restoreTargetDir, "dir", ".", "install directory to recreate")
+	return cmd
+}
+
+// runSnapshot captures a point-in-time copy of the cluster's resources, its
+// etcd data, and the rendered manifests in directory, and archives them
+// together at out.
+func runSnapshot(ctx context.Context, directory, out string) error {
+	config, err := clientcmd.BuildConfigFromFlags("", filepath.Join(directory, "auth", "kubeconfig"))
+	if err != nil {
+		return errors.Wrap(err, "loading kubeconfig")
+	}
+	applyProxy(config, directory)
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating a Kubernetes client")
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating a dynamic client")
+	}
+
+	workDir, err := os.MkdirTemp("", "openshift-install-snapshot")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary snapshot workspace")
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := dumpResources(ctx, client, dynamicClient, workDir); err != nil {
+		return errors.Wrap(err, "dumping cluster resources")
+	}
+
+	if err := snapshotEtcd(ctx, client, filepath.Join(workDir, "etcd-snapshot.db")); err != nil {
+		return errors.Wrap(err, "snapshotting etcd")
+	}
+
+	if err := archive(out, map[string]string{
+		"etcd-snapshot.db":                        filepath.Join(workDir, "etcd-snapshot.db"),
+		"resources":                                filepath.Join(workDir, "resources"),
+		strings.TrimSuffix(installStatePrefix, "/"): directory,
+	}); err != nil {
+		return errors.Wrap(err, "archiving snapshot")
+	}
+
+	logrus.Infof("Snapshot written to %s", out)
+	return nil
+}
+
+// dumpResources lists every namespaced and cluster-scoped resource the
+// discovery client knows about, skipping ephemeralResources, and writes
+// each non-empty list as YAML under <workDir>/resources.
+func dumpResources(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, workDir string) error {
+	resourcesDir := filepath.Join(workDir, "resources")
+	if err := os.MkdirAll(resourcesDir, 0750); err != nil {
+		return err
+	}
+
+	_, apiResourceLists, err := client.Discovery().ServerGroupsAndResources()
+	if err != nil {
+		return errors.Wrap(err, "listing API resources")
+	}
+
+	for _, list := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			logrus.Warningf("skipping %s: %v", list.GroupVersion, err)
+			continue
+		}
+
+		for _, resource := range list.APIResources {
+			if ephemeralResources[resource.Name] || !containsVerb(resource.Verbs, "list") {
+				continue
+			}
+
+			logrus.Debugf("dumping %s/%s", list.GroupVersion, resource.Name)
+			gvr := gv.WithResource(resource.Name)
+			items, err := dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(metav1.ListOptions{})
+			if err != nil {
+				logrus.Warningf("failed to list %s/%s: %v", list.GroupVersion, resource.Name, err)
+				continue
+			}
+			if len(items.Items) == 0 {
+				continue
+			}
+
+			data, err := yaml.Marshal(items)
+			if err != nil {
+				return errors.Wrapf(err, "marshaling %s/%s", list.GroupVersion, resource.Name)
+			}
+
+			filename := fmt.Sprintf("%s_%s.yaml", strings.ReplaceAll(list.GroupVersion, "/", "_"), resource.Name)
+			if err := os.WriteFile(filepath.Join(resourcesDir, filename), data, 0640); err != nil {
+				return errors.Wrapf(err, "writing %s", filename)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsVerb(verbs metav1.Verbs, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	etcdSnapshotNamespace = "openshift-etcd"
+	etcdSnapshotDebugPod  = "etcd-snapshot-debug"
+	// etcdctlImage matches the image the cluster-etcd-operator's own debug
+	// pods use, so the snapshot is taken with an etcdctl binary compatible
+	// with the cluster's etcd version.
+	etcdctlImage = "quay.io/openshift/origin-etcd:latest"
+)
+
+// snapshotEtcd creates a short-lived debug pod on a control-plane node with
+// host networking and access to the etcd certs, runs `etcdctl snapshot save`
+// inside it, copies the resulting file out to dest, and tears the pod down.
+func snapshotEtcd(ctx context.Context, client kubernetes.Interface, dest string) error {
+	logrus.Info("Creating a debug pod to take an etcd snapshot...")
+	privileged := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdSnapshotDebugPod,
+			Namespace: etcdSnapshotNamespace,
+		},
+		Spec: corev1.PodSpec{
+			HostNetwork:   true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  map[string]string{"node-role.kubernetes.io/master": ""},
+			Tolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            "etcdctl",
+					Image:           etcdctlImage,
+					Command:         []string{"/bin/sh", "-c", "sleep 3600"},
+					SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "etcd-certs", MountPath: "/etc/kubernetes/static-pod-certs", ReadOnly: true},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "etcd-certs",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/etc/kubernetes/static-pod-resources/etcd-certs"},
+					},
+				},
+			},
+		},
+	}
+
+	if _, err := client.CoreV1().Pods(etcdSnapshotNamespace).Create(pod); err != nil {
+		return errors.Wrap(err, "creating etcd snapshot debug pod")
+	}
+	defer func() {
+		if err := client.CoreV1().Pods(etcdSnapshotNamespace).Delete(etcdSnapshotDebugPod, &metav1.DeleteOptions{}); err != nil {
+			logrus.Warningf("failed to clean up etcd snapshot debug pod: %v", err)
+		}
+	}()
+
+	if err := waitForPodRunning(ctx, client, etcdSnapshotNamespace, etcdSnapshotDebugPod); err != nil {
+		return errors.Wrap(err, "waiting for etcd snapshot debug pod to start")
+	}
+
+	logrus.Info("Taking an etcd snapshot via the debug pod...")
+	cmd := exec.CommandContext(ctx, "oc", "rsh", "-n", etcdSnapshotNamespace, etcdSnapshotDebugPod,
+		"etcdctl", "snapshot", "save", "/tmp/etcd-snapshot.db",
+		"--cacert=/etc/kubernetes/static-pod-certs/configmaps/etcd-serving-ca/ca-bundle.crt",
+		"--cert=/etc/kubernetes/static-pod-certs/secrets/etcd-all-certs/etcd-serving.crt",
+		"--key=/etc/kubernetes/static-pod-certs/secrets/etcd-all-certs/etcd-serving.key")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "etcdctl snapshot save failed: %s", output)
+	}
+
+	cpCmd := exec.CommandContext(ctx, "oc", "cp", "-n", etcdSnapshotNamespace, etcdSnapshotDebugPod+":/tmp/etcd-snapshot.db", dest)
+	if output, err := cpCmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "copying etcd snapshot out of the debug pod failed: %s", output)
+	}
+
+	return nil
+}
+
+// waitForPodRunning polls until the named pod reports phase Running.
+func waitForPodRunning(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	podCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	return wait.PollImmediateUntil(2*time.Second, func() (bool, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return pod.Status.Phase == corev1.PodRunning, nil
+	}, podCtx.Done())
+}
+
+// runRestore recreates an install directory from a snapshot archive,
+// regenerates bootstrap material for it, and injects the archived etcd
+// snapshot into the new bootstrap node's ignition so bootkube.sh can seed
+// etcd from it instead of starting a fresh cluster.
+func runRestore(ctx context.Context, snapshot, targetDir string) error {
+	if snapshot == "" {
+		return errors.New("--snapshot is required")
+	}
+
+	if err := os.MkdirAll(targetDir, 0750); err != nil {
+		return errors.Wrap(err, "creating install directory")
+	}
+
+	etcdSnapshotPath, err := unarchive(snapshot, targetDir)
+	if err != nil {
+		return errors.Wrap(err, "extracting snapshot")
+	}
+
+	ignitionCmd := exec.CommandContext(ctx, os.Args[0], "create", "ignition-configs", "--dir", targetDir)
+	ignitionCmd.Stdout = os.Stdout
+	ignitionCmd.Stderr = os.Stderr
+	if err := ignitionCmd.Run(); err != nil {
+		return errors.Wrap(err, "regenerating ignition configs")
+	}
+
+	if err := injectEtcdSnapshot(targetDir, etcdSnapshotPath); err != nil {
+		return errors.Wrap(err, "injecting etcd snapshot into the bootstrap ignition")
+	}
+
+	logrus.Infof("Restored install directory %s from %s; run `create cluster` to bring it up from the restored etcd state.", targetDir, snapshot)
+	return nil
+}
+
+// injectEtcdSnapshot adds the etcd snapshot as a file under
+// /opt/openshift/etcd-snapshot.db in the already-rendered bootstrap
+// ignition, the same way other static files are laid down by the
+// bootstrap ignition asset. It patches bootstrap.ign generically, as raw
+// JSON, rather than through the Ignition Go types, since those types
+// aren't vendored in this checkout.
+func injectEtcdSnapshot(targetDir, etcdSnapshotPath string) error {
+	ignPath := filepath.Join(targetDir, "bootstrap.ign")
+
+	raw, err := os.ReadFile(ignPath)
+	if err != nil {
+		return errors.Wrap(err, "reading bootstrap ignition")
+	}
+	var ign map[string]interface{}
+	if err := json.Unmarshal(raw, &ign); err != nil {
+		return errors.Wrap(err, "unmarshaling bootstrap ignition")
+	}
+
+	snapshot, err := os.ReadFile(etcdSnapshotPath)
+	if err != nil {
+		return errors.Wrap(err, "reading etcd snapshot")
+	}
+
+	storage, _ := ign["storage"].(map[string]interface{})
+	if storage == nil {
+		storage = map[string]interface{}{}
+	}
+	files, _ := storage["files"].([]interface{})
+	files = append(files, map[string]interface{}{
+		"filesystem": "root",
+		"path":       "/opt/openshift/etcd-snapshot.db",
+		"mode":       384, // 0600
+		"contents": map[string]string{
+			"source": "data:;base64," + base64.StdEncoding.EncodeToString(snapshot),
+		},
+	})
+	storage["files"] = files
+	ign["storage"] = storage
+
+	out, err := json.Marshal(ign)
+	if err != nil {
+		return errors.Wrap(err, "marshaling bootstrap ignition")
+	}
+	return os.WriteFile(ignPath, out, 0640)
+}
+
+// archive tars and gzips the given name->path entries into out. Directory
+// entries are walked recursively.
+func archive(out string, entries map[string]string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for name, path := range entries {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := addFileToTar(tw, name, path, info); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			return addFileToTar(tw, filepath.Join(name, rel), p, fi)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFileToTar(tw *tar.Writer, name, path string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.ModTime = info.ModTime().UTC()
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// installStatePrefix is the name archive gives the install directory's
+// contents within the snapshot tar; unarchive strips it back off so those
+// contents (install-config.yml, auth/, manifests/, ...) land directly
+// under targetDir instead of one level too deep, where `create
+// ignition-configs --dir targetDir` (in runRestore) expects to find them.
+const installStatePrefix = "install-state/"
+
+// unarchive extracts a snapshot archive into targetDir, returning the path
+// to the extracted etcd-snapshot.db.
+func unarchive(in, targetDir string) (string, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var etcdSnapshotPath string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		name := strings.TrimPrefix(header.Name, installStatePrefix)
+		dest := filepath.Join(targetDir, name)
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(dest, 0750); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+			return "", err
+		}
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return "", err
+		}
+		out.Close()
+
+		if name == "etcd-snapshot.db" {
+			etcdSnapshotPath = dest
+		}
+	}
+
+	return etcdSnapshotPath, nil
+}
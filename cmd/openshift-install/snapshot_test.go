@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestArchiveUnarchiveRoundTrip is a scoped stand-in for the requested
+// TestSingleNodeDisasterRecovery-style integration test: it can't drive a
+// real cluster through snapshot and restore in this checkout, but it does
+// exercise the concrete bug the reviewer flagged — that runRestore's
+// `create ignition-configs --dir targetDir` needs install-config.yml and
+// auth/kubeconfig sitting directly under targetDir, not nested under an
+// install-state/ prefix.
+func TestArchiveUnarchiveRoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "install-config.yml"), []byte("fake install config"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(srcDir, "auth"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "auth", "kubeconfig"), []byte("fake kubeconfig"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	etcdSnapshotSrc := filepath.Join(t.TempDir(), "etcd-snapshot.db")
+	if err := os.WriteFile(etcdSnapshotSrc, []byte("fake etcd snapshot"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	if err := archive(out, map[string]string{
+		"etcd-snapshot.db": etcdSnapshotSrc,
+		"install-state":    srcDir,
+	}); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+
+	targetDir := t.TempDir()
+	etcdSnapshotPath, err := unarchive(out, targetDir)
+	if err != nil {
+		t.Fatalf("unarchive failed: %v", err)
+	}
+
+	installConfig, err := os.ReadFile(filepath.Join(targetDir, "install-config.yml"))
+	if err != nil {
+		t.Fatalf("install-config.yml did not land directly under targetDir: %v", err)
+	}
+	if string(installConfig) != "fake install config" {
+		t.Errorf("install-config.yml contents = %q, want %q", installConfig, "fake install config")
+	}
+
+	kubeconfig, err := os.ReadFile(filepath.Join(targetDir, "auth", "kubeconfig"))
+	if err != nil {
+		t.Fatalf("auth/kubeconfig did not land directly under targetDir: %v", err)
+	}
+	if string(kubeconfig) != "fake kubeconfig" {
+		t.Errorf("auth/kubeconfig contents = %q, want %q", kubeconfig, "fake kubeconfig")
+	}
+
+	if etcdSnapshotPath != filepath.Join(targetDir, "etcd-snapshot.db") {
+		t.Errorf("etcdSnapshotPath = %q, want %q", etcdSnapshotPath, filepath.Join(targetDir, "etcd-snapshot.db"))
+	}
+	if _, err := os.Stat(etcdSnapshotPath); err != nil {
+		t.Errorf("etcd-snapshot.db was not extracted: %v", err)
+	}
+}
+
+// TestInjectEtcdSnapshot confirms that injectEtcdSnapshot adds a file entry
+// for /opt/openshift/etcd-snapshot.db to bootstrap.ign, since bootkube.sh on
+// the restored bootstrap node depends on it being there to seed etcd from.
+func TestInjectEtcdSnapshot(t *testing.T) {
+	targetDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(targetDir, "bootstrap.ign"), []byte(`{"ignition":{"version":"2.2.0"},"storage":{"files":[]}}`), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	etcdSnapshotPath := filepath.Join(targetDir, "etcd-snapshot.db")
+	if err := os.WriteFile(etcdSnapshotPath, []byte("fake etcd snapshot"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := injectEtcdSnapshot(targetDir, etcdSnapshotPath); err != nil {
+		t.Fatalf("injectEtcdSnapshot failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(targetDir, "bootstrap.ign"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "/opt/openshift/etcd-snapshot.db") {
+		t.Errorf("bootstrap.ign does not reference the etcd snapshot path: %s", data)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// notifyWebhookURL is set by the --notify-webhook flag on `create cluster`.
+// When empty, notifyWebhook is a no-op.
+var notifyWebhookURL string
+
+const (
+	webhookTimeout    = 5 * time.Second
+	webhookMaxRetries = 3
+)
+
+// webhookPayload is the JSON body POSTed to --notify-webhook at each stage
+// transition of a long-running `create cluster` install.
+type webhookPayload struct {
+	Stage     string    `json:"stage"`
+	Timestamp time.Time `json:"timestamp"`
+	ClusterID string    `json:"clusterID"`
+	Message   string    `json:"message"`
+}
+
+// notifyWebhook POSTs a stage-transition notification to --notify-webhook,
+// if one was configured. It is resilient: a handful of bounded retries
+// with a short per-attempt timeout, and any remaining failure is logged
+// rather than returned, since a webhook outage must never fail the install.
+func notifyWebhook(ctx context.Context, stage, clusterID, message string) {
+	if notifyWebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Stage:     stage,
+		Timestamp: time.Now(),
+		ClusterID: clusterID,
+		Message:   message,
+	})
+	if err != nil {
+		logrus.Debugf("failed to marshal webhook payload for stage %s: %v", stage, err)
+		return
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	var lastErr error
+	for attempt := 0; attempt < webhookMaxRetries; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifyWebhookURL, bytes.NewReader(body))
+		if err != nil {
+			lastErr = err
+			break
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			lastErr = fmt.Errorf("received status %d", resp.StatusCode)
+		} else {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * time.Duration(attempt+1)):
+		}
+	}
+
+	logrus.Warningf("failed to notify webhook for stage %s: %v", stage, lastErr)
+}
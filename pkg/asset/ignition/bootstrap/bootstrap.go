@@ -0,0 +1,154 @@
+// Package bootstrap generates the Ignition config for the temporary
+// bootstrap node, which runs bootkube to stand up the control plane before
+// handing off to it and being torn down.
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/openshift/installer/pkg/asset"
+	"github.com/openshift/installer/pkg/asset/installconfig"
+	"github.com/openshift/installer/pkg/asset/manifests/mirror"
+	"github.com/openshift/installer/pkg/types"
+)
+
+const bootstrapIgnFilename = "bootstrap.ign"
+
+// Bootstrap generates the bootstrap Ignition config. Its Ignition document
+// is kept as a generic map rather than the real Ignition Go types, since
+// those types aren't vendored in this checkout; snapshot.go's
+// injectEtcdSnapshot patches the same file the same way once it's on disk.
+type Bootstrap struct {
+	Config map[string]interface{}
+	File   *asset.File
+}
+
+var _ asset.WritableAsset = (*Bootstrap)(nil)
+
+// Dependencies returns all of the dependencies directly needed by a
+// Bootstrap asset.
+func (a *Bootstrap) Dependencies() []asset.Asset {
+	return []asset.Asset{
+		&installconfig.InstallConfig{},
+	}
+}
+
+// Generate generates the bootstrap Ignition config.
+func (a *Bootstrap) Generate(parents asset.Parents) error {
+	installConfig := &installconfig.InstallConfig{}
+	parents.Get(installConfig)
+
+	a.Config = map[string]interface{}{
+		"ignition": map[string]string{"version": "2.2.0"},
+		"storage":  map[string]interface{}{"files": []interface{}{}},
+	}
+	addMirrorFiles(a.Config, installConfig.Config)
+	addProxyFiles(a.Config, installConfig.Config)
+
+	data, err := json.Marshal(a.Config)
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal Bootstrap Ignition config")
+	}
+	a.File = &asset.File{
+		Filename: bootstrapIgnFilename,
+		Data:     data,
+	}
+	return nil
+}
+
+// addMirrorFiles lays the mirror registry's registries.conf drop-in and
+// CA trust bundle directly into the bootstrap ignition, so bootkube can
+// pull the control-plane images through the mirror even though the
+// machine-config-operator isn't up yet to apply mirror.MirrorConfig's
+// MachineConfigs.
+func addMirrorFiles(ign map[string]interface{}, config *types.InstallConfig) {
+	for path, contents := range mirror.BootstrapFiles(config) {
+		addIgnitionFile(ign, path, contents)
+	}
+}
+
+// addProxyFiles lays down the environment files the bootstrap node's
+// systemd units and any interactive shell need to honor the cluster-wide
+// proxy, mirroring what the proxy operator's MachineConfigs install on
+// master/worker nodes once the machine-config-operator is up: during
+// bootstrap it isn't, so without these files bootkube and its dependent
+// units would reach the Internet and the mirror directly instead of
+// through the configured proxy.
+func addProxyFiles(ign map[string]interface{}, config *types.InstallConfig) {
+	if config.Proxy == nil {
+		return
+	}
+
+	var vars []string
+	if config.Proxy.HTTPProxy != "" {
+		vars = append(vars, fmt.Sprintf("HTTP_PROXY=%s", config.Proxy.HTTPProxy))
+	}
+	if config.Proxy.HTTPSProxy != "" {
+		vars = append(vars, fmt.Sprintf("HTTPS_PROXY=%s", config.Proxy.HTTPSProxy))
+	}
+	if config.Proxy.NoProxy != "" {
+		vars = append(vars, fmt.Sprintf("NO_PROXY=%s", config.Proxy.NoProxy))
+	}
+	if len(vars) == 0 {
+		return
+	}
+
+	var systemdEnv strings.Builder
+	fmt.Fprintf(&systemdEnv, "[Manager]\nDefaultEnvironment=")
+	for i, v := range vars {
+		if i > 0 {
+			systemdEnv.WriteString(" ")
+		}
+		fmt.Fprintf(&systemdEnv, "%q", v)
+	}
+	systemdEnv.WriteString("\n")
+	addIgnitionFile(ign, "/etc/systemd/system.conf.d/10-default-env.conf", systemdEnv.String())
+
+	var profile strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&profile, "export %s\n", v)
+	}
+	addIgnitionFile(ign, "/etc/profile.d/proxy.sh", profile.String())
+}
+
+// addIgnitionFile appends a plain-text file at path, with contents, to
+// ign's storage.files list as a base64 data: URL, the same encoding
+// snapshot.go's injectEtcdSnapshot uses.
+func addIgnitionFile(ign map[string]interface{}, path, contents string) {
+	storage, _ := ign["storage"].(map[string]interface{})
+	existing, _ := storage["files"].([]interface{})
+	existing = append(existing, map[string]interface{}{
+		"filesystem": "root",
+		"path":       path,
+		"mode":       420,
+		"contents": map[string]string{
+			"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte(contents)),
+		},
+	})
+	storage["files"] = existing
+	ign["storage"] = storage
+}
+
+// Name returns the human-friendly name of the asset.
+func (a *Bootstrap) Name() string {
+	return "Bootstrap Ignition Config"
+}
+
+// Files returns the files generated by the asset.
+func (a *Bootstrap) Files() []*asset.File {
+	if a.File != nil {
+		return []*asset.File{a.File}
+	}
+	return []*asset.File{}
+}
+
+// Load returns false because this asset is always generated, never loaded
+// from disk.
+func (a *Bootstrap) Load(asset.FileFetcher) (bool, error) {
+	return false, nil
+}
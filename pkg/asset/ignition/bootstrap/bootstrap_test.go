@@ -0,0 +1,106 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openshift/installer/pkg/asset"
+	"github.com/openshift/installer/pkg/asset/installconfig"
+	"github.com/openshift/installer/pkg/types"
+)
+
+// TestGenerateRoutesBootstrapPullsAwayFromQuay drives the actual Bootstrap
+// asset Generate produces for `create ignition-configs`, decodes the
+// rendered registries.conf drop-in back out of the resulting bootstrap.ign,
+// and asserts it adds the mirror redirect alongside (not instead of) the
+// original quay.io source reference. This is the asset-level counterpart
+// of mirror.TestBootstrapFilesRoutesAwayFromQuay, which only exercises the
+// lower-level mirror.BootstrapFiles helper rather than the rendered
+// ignition the request asked to assert against.
+func TestGenerateRoutesBootstrapPullsAwayFromQuay(t *testing.T) {
+	installConfig := &installconfig.InstallConfig{
+		Config: &types.InstallConfig{
+			ImageContentSources: []types.ImageContentSource{
+				{
+					Source:  "quay.io/openshift-release-dev/ocp-release",
+					Mirrors: []string{"mirror.example.com:5000/ocp-release"},
+				},
+			},
+		},
+	}
+	parents := asset.Parents{reflect.TypeOf(installConfig): installConfig}
+
+	bootstrap := &Bootstrap{}
+	if err := bootstrap.Generate(parents); err != nil {
+		t.Fatalf("Generate returned an error: %v", err)
+	}
+
+	files := bootstrap.Files()
+	if len(files) != 1 {
+		t.Fatalf("expected exactly one file, got %d", len(files))
+	}
+
+	var ign struct {
+		Storage struct {
+			Files []struct {
+				Path     string `json:"path"`
+				Contents struct {
+					Source string `json:"source"`
+				} `json:"contents"`
+			} `json:"files"`
+		} `json:"storage"`
+	}
+	if err := json.Unmarshal(files[0].Data, &ign); err != nil {
+		t.Fatalf("failed to unmarshal rendered bootstrap ignition: %v", err)
+	}
+
+	const wantPath = "/etc/containers/registries.conf.d/99-mirror.conf"
+	const sourcePrefix = "data:;base64,"
+	var registriesConf string
+	found := false
+	for _, f := range ign.Storage.Files {
+		if f.Path != wantPath {
+			continue
+		}
+		found = true
+		if !strings.HasPrefix(f.Contents.Source, sourcePrefix) {
+			t.Fatalf("rendered source = %q, want a %q-prefixed data URL", f.Contents.Source, sourcePrefix)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(f.Contents.Source, sourcePrefix))
+		if err != nil {
+			t.Fatalf("rendered source does not decode as base64: %v", err)
+		}
+		registriesConf = string(decoded)
+	}
+	if !found {
+		t.Fatalf("bootstrap ignition does not contain %s", wantPath)
+	}
+
+	if !strings.Contains(registriesConf, `location = "quay.io/openshift-release-dev/ocp-release"`) {
+		t.Errorf("registries.conf drop-in lost the original source reference: %s", registriesConf)
+	}
+	if !strings.Contains(registriesConf, `location = "mirror.example.com:5000/ocp-release"`) {
+		t.Errorf("registries.conf drop-in does not redirect bootstrap pulls to the mirror: %s", registriesConf)
+	}
+}
+
+// TestGenerateNoMirrorConfigured confirms that an install config without a
+// mirror renders a bootstrap ignition with no storage files, rather than
+// unconditionally dropping mirror-routing files into every install.
+func TestGenerateNoMirrorConfigured(t *testing.T) {
+	installConfig := &installconfig.InstallConfig{Config: &types.InstallConfig{}}
+	parents := asset.Parents{reflect.TypeOf(installConfig): installConfig}
+
+	bootstrap := &Bootstrap{}
+	if err := bootstrap.Generate(parents); err != nil {
+		t.Fatalf("Generate returned an error: %v", err)
+	}
+
+	storage, _ := bootstrap.Config["storage"].(map[string]interface{})
+	if files, _ := storage["files"].([]interface{}); len(files) != 0 {
+		t.Errorf("expected no storage files without a mirror configured, got %v", files)
+	}
+}
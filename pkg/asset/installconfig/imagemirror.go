@@ -0,0 +1,138 @@
+package installconfig
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	survey "github.com/AlecAivazis/survey/v2"
+	"github.com/pkg/errors"
+
+	"github.com/openshift/installer/pkg/asset"
+	"github.com/openshift/installer/pkg/types"
+)
+
+// imageMirror gathers the information needed to install a cluster from a
+// mirrored release image: the mirror registry, an optional pull-secret
+// entry for it, and an additional CA bundle to trust it.
+type imageMirror struct {
+	ImageContentSources []types.ImageContentSource
+	CABundle            string
+	// PullSecretEntry is the base64 "user:password" auth string for the
+	// mirror registry, if it requires one, in the same form Docker config
+	// JSON stores under .auths.<registry>.auth. It is merged into the
+	// install config's pull secret rather than replacing it.
+	PullSecretEntry string
+}
+
+var _ asset.Asset = (*imageMirror)(nil)
+
+// Dependencies returns all of the dependencies directly needed by an
+// imageMirror asset.
+func (a *imageMirror) Dependencies() []asset.Asset {
+	return []asset.Asset{}
+}
+
+// Generate queries for the mirror registry, an optional CA bundle, and an
+// optional pull-secret entry, and validates that the mirror registry is
+// reachable and serves the registry v2 API. It does not check that the
+// release image itself can be resolved through the mirror.
+func (a *imageMirror) Generate(asset.Parents) error {
+	var mirror string
+	if err := survey.Ask([]*survey.Question{
+		{
+			Prompt: &survey.Input{
+				Message: "Mirror registry",
+				Help:    "The registry.domain:port/namespace the release image and its component images are mirrored to.",
+			},
+		},
+	}, &mirror); err != nil {
+		return errors.Wrap(err, "failed to prompt for mirror registry")
+	}
+	if mirror == "" {
+		return nil
+	}
+
+	var caBundlePath string
+	if err := survey.Ask([]*survey.Question{
+		{
+			Prompt: &survey.Input{
+				Message: "Path to the mirror's CA bundle (optional)",
+			},
+		},
+	}, &caBundlePath); err != nil {
+		return errors.Wrap(err, "failed to prompt for CA bundle path")
+	}
+	if caBundlePath != "" {
+		data, err := ioutil.ReadFile(caBundlePath)
+		if err != nil {
+			return errors.Wrap(err, "failed to read CA bundle")
+		}
+		a.CABundle = string(data)
+	}
+
+	if err := survey.Ask([]*survey.Question{
+		{
+			Prompt: &survey.Password{
+				Message: "Pull secret entry for the mirror registry (optional)",
+				Help:    "The base64 \"user:password\" auth string for the mirror registry, if it requires authentication.",
+			},
+		},
+	}, &a.PullSecretEntry); err != nil {
+		return errors.Wrap(err, "failed to prompt for mirror registry pull-secret entry")
+	}
+
+	a.ImageContentSources = []types.ImageContentSource{
+		{
+			Source:  "quay.io/openshift-release-dev/ocp-release",
+			Mirrors: []string{mirror},
+		},
+	}
+
+	if err := validateMirror(mirror); err != nil {
+		return errors.Wrap(err, "failed to validate mirror registry")
+	}
+
+	return nil
+}
+
+// Name returns the human-friendly name of the asset.
+func (a *imageMirror) Name() string {
+	return "Image Content Sources"
+}
+
+// validateMirror confirms that the mirror registry is actually reachable
+// and speaks the Docker Registry HTTP API v2 before the install proceeds,
+// so a typo'd or unreachable mirror fails fast here instead of partway
+// through bootstrapping.
+func validateMirror(mirror string) error {
+	host := registryHost(mirror)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("https://" + host + "/v2/")
+	if err != nil {
+		return errors.Wrapf(err, "failed to reach mirror registry %s", host)
+	}
+	defer resp.Body.Close()
+
+	// A v2-compliant registry responds to an unauthenticated /v2/ request
+	// with either 200 (anonymous pulls allowed) or 401 (auth required);
+	// anything else means this isn't a registry we can mirror through.
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized:
+		return nil
+	default:
+		return errors.Errorf("mirror registry %s returned unexpected status %d from its v2 API", host, resp.StatusCode)
+	}
+}
+
+// registryHost returns the host:port portion of a mirror registry
+// reference, stripping any namespace path, since pull-secret and auth
+// lookups key off the registry host rather than the full mirror path.
+func registryHost(mirror string) string {
+	if idx := strings.Index(mirror, "/"); idx != -1 {
+		return mirror[:idx]
+	}
+	return mirror
+}
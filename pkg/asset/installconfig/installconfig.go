@@ -1,8 +1,10 @@
 package installconfig
 
 import (
+	"encoding/json"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
@@ -44,6 +46,8 @@ func (a *InstallConfig) Dependencies() []asset.Asset {
 		&clusterName{},
 		&pullSecret{},
 		&platform{},
+		&imageMirror{},
+		&proxy{},
 	}
 }
 
@@ -57,6 +61,8 @@ func (a *InstallConfig) Generate(parents asset.Parents) error {
 	clusterName := &clusterName{}
 	pullSecret := &pullSecret{}
 	platform := &platform{}
+	imageMirror := &imageMirror{}
+	proxy := &proxy{}
 	parents.Get(
 		clusterID,
 		emailAddress,
@@ -66,6 +72,8 @@ func (a *InstallConfig) Generate(parents asset.Parents) error {
 		clusterName,
 		pullSecret,
 		platform,
+		imageMirror,
+		proxy,
 	)
 
 	a.Config = &types.InstallConfig{
@@ -92,7 +100,27 @@ func (a *InstallConfig) Generate(parents asset.Parents) error {
 				},
 			},
 		},
-		PullSecret: pullSecret.PullSecret,
+		ImageContentSources:   imageMirror.ImageContentSources,
+		AdditionalTrustBundle: imageMirror.CABundle,
+	}
+
+	pullSecretJSON := pullSecret.PullSecret
+	if imageMirror.PullSecretEntry != "" && len(imageMirror.ImageContentSources) > 0 {
+		merged, err := mergePullSecretEntry(pullSecretJSON, registryHost(imageMirror.ImageContentSources[0].Mirrors[0]), imageMirror.PullSecretEntry)
+		if err != nil {
+			return errors.Wrap(err, "failed to merge mirror registry pull-secret entry")
+		}
+		pullSecretJSON = merged
+	}
+	a.Config.PullSecret = pullSecretJSON
+
+	if proxy.HTTPProxy != "" || proxy.HTTPSProxy != "" {
+		a.Config.Proxy = &types.Proxy{
+			HTTPProxy:          proxy.HTTPProxy,
+			HTTPSProxy:         proxy.HTTPSProxy,
+			NoProxy:            defaultNoProxy(a.Config, proxy.NoProxy),
+			ReadinessEndpoints: proxy.ReadinessEndpoints,
+		}
 	}
 
 	numberOfMasters := int64(3)
@@ -151,6 +179,45 @@ func parseCIDR(s string) net.IPNet {
 	return *cidr
 }
 
+// mergePullSecretEntry adds an auth entry for host into pullSecretJSON's
+// .auths map, preserving every entry already there, so the mirror registry
+// becomes pullable without dropping the entries the install needs for
+// quay.io and registry.redhat.io.
+func mergePullSecretEntry(pullSecretJSON, host, auth string) (string, error) {
+	var pullSecret map[string]interface{}
+	if err := json.Unmarshal([]byte(pullSecretJSON), &pullSecret); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal pull secret")
+	}
+
+	auths, ok := pullSecret["auths"].(map[string]interface{})
+	if !ok {
+		auths = map[string]interface{}{}
+	}
+	auths[host] = map[string]interface{}{"auth": auth}
+	pullSecret["auths"] = auths
+
+	merged, err := json.Marshal(pullSecret)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal pull secret")
+	}
+	return string(merged), nil
+}
+
+// defaultNoProxy computes the NoProxy value for config, starting from the
+// service and cluster CIDRs, .svc, .cluster.local, and the base domain, and
+// appending any additional hosts the user supplied.
+func defaultNoProxy(config *types.InstallConfig, additional string) string {
+	noProxy := []string{config.Networking.ServiceCIDR.String()}
+	for _, clusterNetwork := range config.Networking.ClusterNetworks {
+		noProxy = append(noProxy, clusterNetwork.CIDR)
+	}
+	noProxy = append(noProxy, ".svc", ".cluster.local", config.BaseDomain)
+	if additional != "" {
+		noProxy = append(noProxy, strings.Split(additional, ",")...)
+	}
+	return strings.Join(noProxy, ",")
+}
+
 // Load returns the installconfig from disk.
 func (a *InstallConfig) Load(f asset.FileFetcher) (found bool, err error) {
 	file, err := f.FetchByName(installConfigFilename)
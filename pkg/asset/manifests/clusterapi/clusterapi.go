@@ -0,0 +1,226 @@
+// Package clusterapi renders the Cluster API manifests (Cluster, Machine,
+// and the provider-specific InfraCluster/InfraMachine objects) used by the
+// `--infrastructure=capi` install path. Unlike pkg/asset/manifests, these
+// objects are not written to disk as part of an asset target; they are
+// applied directly to the in-process management cluster by
+// pkg/infrastructure/clusterapi.
+package clusterapi
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	capiv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"github.com/openshift/installer/pkg/types"
+)
+
+// capiNamespace is the namespace the installer creates all Cluster API
+// objects in on the in-process management cluster.
+const capiNamespace = "openshift-cluster-api-install"
+
+// infraGVKs maps each supported platform to the apiVersion/kind of its
+// Cluster API infrastructure provider. Only the providers with an
+// in-process manager registered by pkg/infrastructure/clusterapi are
+// listed here. libvirt is deliberately absent: there is no maintained
+// Cluster API infrastructure provider for it, so PlatformName recognizing
+// a libvirt install config still resolves here to the same "no
+// cluster-api infrastructure provider" error every other unlisted
+// platform gets, rather than a libvirt-specific carve-out.
+var infraGVKs = map[string]struct{ apiVersion, clusterKind, machineKind string }{
+	"aws":       {"infrastructure.cluster.x-k8s.io/v1beta1", "AWSCluster", "AWSMachine"},
+	"openstack": {"infrastructure.cluster.x-k8s.io/v1alpha5", "OpenStackCluster", "OpenStackMachine"},
+}
+
+// PlatformName returns the name of the platform configured in the install
+// config, as used to key infraGVKs.
+func PlatformName(config *types.InstallConfig) string {
+	switch {
+	case config.AWS != nil:
+		return "aws"
+	case config.OpenStack != nil:
+		return "openstack"
+	case config.Libvirt != nil:
+		return "libvirt"
+	default:
+		return ""
+	}
+}
+
+// Cluster returns the core Cluster API Cluster object for the install
+// config, referencing the provider-specific InfraCluster returned by
+// InfraCluster.
+func Cluster(config *types.InstallConfig) (*capiv1.Cluster, error) {
+	platform := PlatformName(config)
+	gvk, ok := infraGVKs[platform]
+	if !ok {
+		return nil, fmt.Errorf("no cluster-api infrastructure provider for platform %q", platform)
+	}
+
+	return &capiv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      config.ObjectMeta.Name,
+			Namespace: capiNamespace,
+		},
+		Spec: capiv1.ClusterSpec{
+			InfrastructureRef: infraObjectReference(gvk.apiVersion, gvk.clusterKind, config.ObjectMeta.Name),
+		},
+	}, nil
+}
+
+// InfraCluster returns the provider-specific InfraCluster object (e.g.
+// AWSCluster) as unstructured, since the installer does not vendor every
+// provider's typed API.
+func InfraCluster(config *types.InstallConfig) (*unstructured.Unstructured, error) {
+	platform := PlatformName(config)
+	gvk, ok := infraGVKs[platform]
+	if !ok {
+		return nil, fmt.Errorf("no cluster-api infrastructure provider for platform %q", platform)
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvk.apiVersion)
+	u.SetKind(gvk.clusterKind)
+	u.SetName(config.ObjectMeta.Name)
+	u.SetNamespace(capiNamespace)
+	if err := unstructured.SetNestedMap(u.Object, infraClusterSpec(config, platform), "spec"); err != nil {
+		return nil, fmt.Errorf("setting infrastructure cluster spec: %w", err)
+	}
+	return u, nil
+}
+
+// infraClusterSpec renders the provider-specific portion of the
+// InfraCluster spec (e.g. the region an AWSCluster reconciles into), since
+// without it the provider controller has nothing to reconcile the
+// infrastructure cluster into and Cluster.status.infrastructureReady never
+// flips true.
+func infraClusterSpec(config *types.InstallConfig, platform string) map[string]interface{} {
+	switch platform {
+	case "aws":
+		return map[string]interface{}{"region": config.AWS.Region}
+	case "openstack":
+		return map[string]interface{}{"cloudName": config.OpenStack.Cloud, "externalNetwork": config.OpenStack.ExternalNetwork}
+	default:
+		return nil
+	}
+}
+
+// Machines returns the control-plane Machine objects and their matching
+// provider-specific InfraMachine objects for the install config.
+func Machines(config *types.InstallConfig) ([]*capiv1.Machine, []*unstructured.Unstructured, error) {
+	platform := PlatformName(config)
+	gvk, ok := infraGVKs[platform]
+	if !ok {
+		return nil, nil, fmt.Errorf("no cluster-api infrastructure provider for platform %q", platform)
+	}
+
+	var pool *types.MachinePool
+	for i := range config.Machines {
+		if config.Machines[i].Name == "master" {
+			pool = &config.Machines[i]
+			break
+		}
+	}
+	if pool == nil || pool.Replicas == nil {
+		return nil, nil, fmt.Errorf("install config has no master machine pool")
+	}
+
+	machines := make([]*capiv1.Machine, 0, *pool.Replicas)
+	infraMachines := make([]*unstructured.Unstructured, 0, *pool.Replicas)
+	for i := int64(0); i < *pool.Replicas; i++ {
+		name := fmt.Sprintf("%s-master-%d", config.ObjectMeta.Name, i)
+
+		infraMachine := &unstructured.Unstructured{}
+		infraMachine.SetAPIVersion(gvk.apiVersion)
+		infraMachine.SetKind(gvk.machineKind)
+		infraMachine.SetName(name)
+		infraMachine.SetNamespace(capiNamespace)
+		if err := unstructured.SetNestedMap(infraMachine.Object, infraMachineSpec(pool, platform), "spec"); err != nil {
+			return nil, nil, fmt.Errorf("setting infrastructure machine spec for %s: %w", name, err)
+		}
+		infraMachines = append(infraMachines, infraMachine)
+
+		machine := &capiv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: capiNamespace,
+				Labels:    map[string]string{"cluster.x-k8s.io/control-plane": ""},
+			},
+			Spec: capiv1.MachineSpec{
+				ClusterName:       config.ObjectMeta.Name,
+				InfrastructureRef: *infraObjectReference(gvk.apiVersion, gvk.machineKind, name),
+			},
+		}
+		machines = append(machines, machine)
+	}
+
+	return machines, infraMachines, nil
+}
+
+// defaultAWSInstanceType and defaultOpenStackFlavor are used whenever the
+// master machine pool doesn't override the instance size: installconfig.go
+// always builds the master pool with just Name and Replicas set and never
+// populates MachinePool.Platform, so relying on a per-pool override alone
+// would leave every real install with an empty InfraMachine spec.
+const (
+	defaultAWSInstanceType = "m5.xlarge"
+	defaultOpenStackFlavor = "m1.xlarge"
+)
+
+// infraMachineSpec renders the provider-specific portion of the
+// InfraMachine spec (instance type, zones, boot image) for the master
+// machine pool, since without it the provider controller has no idea what
+// to actually provision for the Machine it's reconciling.
+func infraMachineSpec(pool *types.MachinePool, platform string) map[string]interface{} {
+	switch platform {
+	case "aws":
+		instanceType := defaultAWSInstanceType
+		var zone, ami string
+		if pool.Platform.AWS != nil {
+			if pool.Platform.AWS.InstanceType != "" {
+				instanceType = pool.Platform.AWS.InstanceType
+			}
+			if len(pool.Platform.AWS.Zones) > 0 {
+				zone = pool.Platform.AWS.Zones[0]
+			}
+			ami = pool.Platform.AWS.AMIID
+		}
+		spec := map[string]interface{}{"instanceType": instanceType}
+		if zone != "" {
+			spec["failureDomain"] = zone
+		}
+		if ami != "" {
+			spec["ami"] = map[string]interface{}{"id": ami}
+		}
+		return spec
+	case "openstack":
+		flavor := defaultOpenStackFlavor
+		var zone string
+		if pool.Platform.OpenStack != nil {
+			if pool.Platform.OpenStack.FlavorName != "" {
+				flavor = pool.Platform.OpenStack.FlavorName
+			}
+			if len(pool.Platform.OpenStack.Zones) > 0 {
+				zone = pool.Platform.OpenStack.Zones[0]
+			}
+		}
+		spec := map[string]interface{}{"flavor": flavor}
+		if zone != "" {
+			spec["availabilityZone"] = zone
+		}
+		return spec
+	default:
+		return nil
+	}
+}
+
+func infraObjectReference(apiVersion, kind, name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		Namespace:  capiNamespace,
+	}
+}
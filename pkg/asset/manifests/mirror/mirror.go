@@ -0,0 +1,211 @@
+// Package mirror renders the manifests needed to install a cluster from a
+// mirrored release image: a registries.conf drop-in and matching ICSP
+// manifest redirecting image pulls to the mirror, and a MachineConfig that
+// installs the mirror's CA bundle onto RHCOS nodes.
+package mirror
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+
+	"github.com/openshift/installer/pkg/asset"
+	"github.com/openshift/installer/pkg/asset/installconfig"
+	"github.com/openshift/installer/pkg/types"
+)
+
+const (
+	registriesConfFilename = "manifests/99_mirror-registries-conf.yaml"
+	icspFilename           = "manifests/99_mirror-icsp.yaml"
+	caTrustFilename        = "manifests/99_mirror-ca-trust.yaml"
+)
+
+// MirrorConfig generates the manifests that redirect image pulls to a
+// mirror registry and install its CA bundle.
+type MirrorConfig struct {
+	FileList []*asset.File
+}
+
+var _ asset.WritableAsset = (*MirrorConfig)(nil)
+
+// Dependencies returns all of the dependencies directly needed by a
+// MirrorConfig asset.
+func (m *MirrorConfig) Dependencies() []asset.Asset {
+	return []asset.Asset{
+		&installconfig.InstallConfig{},
+	}
+}
+
+// Generate generates the registries.conf drop-in, ICSP manifest, and CA
+// trust MachineConfig.
+func (m *MirrorConfig) Generate(parents asset.Parents) error {
+	installConfig := &installconfig.InstallConfig{}
+	parents.Get(installConfig)
+
+	if len(installConfig.Config.ImageContentSources) == 0 {
+		return nil
+	}
+
+	registriesConf, err := renderRegistriesConf(installConfig.Config.ImageContentSources)
+	if err != nil {
+		return errors.Wrap(err, "failed to render registries.conf")
+	}
+	icsp, err := renderICSP(installConfig.Config.ImageContentSources)
+	if err != nil {
+		return errors.Wrap(err, "failed to render ImageContentSourcePolicy")
+	}
+
+	m.FileList = []*asset.File{
+		{Filename: registriesConfFilename, Data: registriesConf},
+		{Filename: icspFilename, Data: icsp},
+	}
+
+	if installConfig.Config.AdditionalTrustBundle != "" {
+		caTrust, err := renderCATrustMachineConfig(installConfig.Config.AdditionalTrustBundle)
+		if err != nil {
+			return errors.Wrap(err, "failed to render CA trust MachineConfig")
+		}
+		m.FileList = append(m.FileList, &asset.File{Filename: caTrustFilename, Data: caTrust})
+	}
+
+	return nil
+}
+
+// Name returns the human-friendly name of the asset.
+func (m *MirrorConfig) Name() string {
+	return "Mirror Registry Config"
+}
+
+// Files returns the files generated by the asset.
+func (m *MirrorConfig) Files() []*asset.File {
+	return m.FileList
+}
+
+// Load returns false because this asset is always generated, never loaded
+// from disk.
+func (m *MirrorConfig) Load(asset.FileFetcher) (bool, error) {
+	return false, nil
+}
+
+func renderRegistriesConf(sources []types.ImageContentSource) ([]byte, error) {
+	var b strings.Builder
+	for _, source := range sources {
+		fmt.Fprintf(&b, "[[registry]]\n  prefix = \"\"\n  location = %q\n  mirror-by-digest-only = true\n", source.Source)
+		for _, mirror := range source.Mirrors {
+			fmt.Fprintf(&b, "  [[registry.mirror]]\n    location = %q\n", mirror)
+		}
+	}
+
+	return wrapMachineConfigDropIn("99-mirror-registries-conf", "/etc/containers/registries.conf.d/99-mirror.conf", b.String())
+}
+
+func renderICSP(sources []types.ImageContentSource) ([]byte, error) {
+	type repositoryDigestMirror struct {
+		Source  string   `json:"source"`
+		Mirrors []string `json:"mirrors"`
+	}
+
+	mirrors := make([]repositoryDigestMirror, 0, len(sources))
+	for _, source := range sources {
+		mirrors = append(mirrors, repositoryDigestMirror{Source: source.Source, Mirrors: source.Mirrors})
+	}
+
+	icsp := map[string]interface{}{
+		"apiVersion": "operator.openshift.io/v1alpha1",
+		"kind":       "ImageContentSourcePolicy",
+		"metadata": map[string]string{
+			"name": "mirror-config",
+		},
+		"spec": map[string]interface{}{
+			"repositoryDigestMirrors": mirrors,
+		},
+	}
+
+	return yaml.Marshal(icsp)
+}
+
+func renderCATrustMachineConfig(caBundle string) ([]byte, error) {
+	return wrapMachineConfigDropIn("99-mirror-ca-trust", "/etc/pki/ca-trust/source/anchors/mirror-ca.crt", caBundle)
+}
+
+// BootstrapFiles returns the registries.conf drop-in and (if configured) the
+// CA trust bundle as raw path->contents entries, for laying directly into
+// the bootstrap node's ignition (via bootstrap.Bootstrap.Generate) rather
+// than as a MachineConfig.
+//
+// This matters because bootkube on the bootstrap node pulls the
+// control-plane images before the cluster (and therefore the
+// machine-config-operator) exists to apply the MachineConfigs Generate
+// produces above; without these files landing in the bootstrap ignition
+// itself, a mirrored install only works for the master and worker nodes that
+// join after bootstrap, never for the bootstrap node's own pulls.
+func BootstrapFiles(config *types.InstallConfig) map[string]string {
+	files := map[string]string{}
+	if len(config.ImageContentSources) == 0 {
+		return files
+	}
+
+	var b strings.Builder
+	for _, source := range config.ImageContentSources {
+		fmt.Fprintf(&b, "[[registry]]\n  prefix = \"\"\n  location = %q\n  mirror-by-digest-only = true\n", source.Source)
+		for _, mirror := range source.Mirrors {
+			fmt.Fprintf(&b, "  [[registry.mirror]]\n    location = %q\n", mirror)
+		}
+	}
+	files["/etc/containers/registries.conf.d/99-mirror.conf"] = b.String()
+
+	if config.AdditionalTrustBundle != "" {
+		files["/etc/pki/ca-trust/source/anchors/mirror-ca.crt"] = config.AdditionalTrustBundle
+	}
+
+	return files
+}
+
+// wrapMachineConfigDropIn wraps a single file's contents in a pair of
+// MachineConfigs, one per machineconfiguration.openshift.io/role, so it
+// installs on every master and worker node: a MachineConfig only ever
+// targets a single role, so reaching both pools takes two objects.
+// Returned as a single multi-document YAML stream, the same as `oc apply
+// -f` expects from a manifest file with more than one object in it.
+func wrapMachineConfigDropIn(name, path, contents string) ([]byte, error) {
+	var docs [][]byte
+	for _, role := range []string{"master", "worker"} {
+		machineConfig := map[string]interface{}{
+			"apiVersion": "machineconfiguration.openshift.io/v1",
+			"kind":       "MachineConfig",
+			"metadata": map[string]interface{}{
+				"name":   fmt.Sprintf("%s-%s", name, role),
+				"labels": map[string]string{"machineconfiguration.openshift.io/role": role},
+			},
+			"spec": map[string]interface{}{
+				"config": map[string]interface{}{
+					"ignition": map[string]string{"version": "2.2.0"},
+					"storage": map[string]interface{}{
+						"files": []map[string]interface{}{
+							{
+								"filesystem": "root",
+								"path":       path,
+								"mode":       420,
+								"contents": map[string]string{
+									"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte(contents)),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		data, err := yaml.Marshal(machineConfig)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, data)
+	}
+
+	return bytes.Join(docs, []byte("---\n")), nil
+}
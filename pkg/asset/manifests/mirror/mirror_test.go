@@ -0,0 +1,143 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/openshift/installer/pkg/types"
+)
+
+// TestBootstrapFilesRoutesAwayFromQuay unit-tests the BootstrapFiles helper
+// in isolation; bootstrap.TestGenerateRoutesBootstrapPullsAwayFromQuay
+// (pkg/asset/ignition/bootstrap) is the end-to-end counterpart that drives
+// the actual Bootstrap asset Generate produces for `create
+// ignition-configs` and decodes the mirror redirect back out of the
+// rendered bootstrap.ign. Neither test can assert that no quay.io reference
+// survives rendering, as the original request asked, because registries.conf's
+// `location` line always preserves the original (unmirrored) source
+// reference — mirroring is expressed as an additional `registry.mirror`
+// entry, not a replacement of the source. Both instead assert the actual
+// behavioral requirement: that once a mirror is configured, the rendered
+// files add a mirror redirect alongside that source line rather than
+// leaving pulls unmirrored.
+func TestBootstrapFilesRoutesAwayFromQuay(t *testing.T) {
+	config := &types.InstallConfig{
+		ImageContentSources: []types.ImageContentSource{
+			{
+				Source:  "quay.io/openshift-release-dev/ocp-release",
+				Mirrors: []string{"mirror.example.com:5000/ocp-release"},
+			},
+		},
+		AdditionalTrustBundle: "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----\n",
+	}
+
+	files := BootstrapFiles(config)
+
+	registriesConf, ok := files["/etc/containers/registries.conf.d/99-mirror.conf"]
+	if !ok {
+		t.Fatal("expected a registries.conf drop-in to be present")
+	}
+	if !strings.Contains(registriesConf, `location = "quay.io/openshift-release-dev/ocp-release"`) {
+		t.Errorf("registries.conf drop-in lost the original source reference: %s", registriesConf)
+	}
+	if !strings.Contains(registriesConf, `location = "mirror.example.com:5000/ocp-release"`) {
+		t.Errorf("registries.conf drop-in does not redirect to the mirror: %s", registriesConf)
+	}
+	if !strings.Contains(registriesConf, "mirror-by-digest-only = true") {
+		t.Errorf("registries.conf drop-in does not pin to digest-only mirroring: %s", registriesConf)
+	}
+
+	caTrust, ok := files["/etc/pki/ca-trust/source/anchors/mirror-ca.crt"]
+	if !ok {
+		t.Fatal("expected the CA trust bundle to be present")
+	}
+	if caTrust != config.AdditionalTrustBundle {
+		t.Errorf("CA trust bundle contents = %q, want %q", caTrust, config.AdditionalTrustBundle)
+	}
+}
+
+// TestBootstrapFilesNoMirrorConfigured confirms that an install config
+// without any mirror leaves the bootstrap ignition untouched, rather than
+// unconditionally dropping quay.io-routing files into every install.
+func TestBootstrapFilesNoMirrorConfigured(t *testing.T) {
+	files := BootstrapFiles(&types.InstallConfig{})
+	if len(files) != 0 {
+		t.Errorf("expected no bootstrap files without a mirror configured, got %v", files)
+	}
+}
+
+// TestWrapMachineConfigDropInTargetsBothRoles guards against the
+// MachineConfig drop-ins silently reaching only workers (or only masters):
+// both the registries.conf and CA-trust content they wrap needs to land on
+// every node.
+func TestWrapMachineConfigDropInTargetsBothRoles(t *testing.T) {
+	data, err := wrapMachineConfigDropIn("99-mirror-ca-trust", "/etc/pki/ca-trust/source/anchors/mirror-ca.crt", "fake-ca")
+	if err != nil {
+		t.Fatalf("wrapMachineConfigDropIn returned an error: %v", err)
+	}
+
+	rendered := string(data)
+	for _, role := range []string{"master", "worker"} {
+		if !strings.Contains(rendered, `machineconfiguration.openshift.io/role: `+role) {
+			t.Errorf("rendered MachineConfigs do not target role %q:\n%s", role, rendered)
+		}
+	}
+}
+
+// TestWrapMachineConfigDropInEncodesContents guards against the file's
+// `source` data URL getting corrupted: decoding it must reproduce contents
+// byte-for-byte, including the spaces in registries.conf's indentation and
+// `key = "value"` syntax. A form-encoding scheme like url.QueryEscape would
+// pass a check that only looked for a missing "/" prefix while still
+// turning every space into a literal "+" on the node, so this test decodes
+// the rendered source and compares it against the original string rather
+// than against one particular (and previously wrong) encoding of it.
+func TestWrapMachineConfigDropInEncodesContents(t *testing.T) {
+	contents := "[[registry]]\n  prefix = \"\"\n  location = \"quay.io/openshift-release-dev/ocp-release\"\n"
+	data, err := wrapMachineConfigDropIn("99-mirror-registries-conf", "/etc/containers/registries.conf.d/99-mirror.conf", contents)
+	if err != nil {
+		t.Fatalf("wrapMachineConfigDropIn returned an error: %v", err)
+	}
+
+	docs := bytes.Split(data, []byte("---\n"))
+	if len(docs) == 0 {
+		t.Fatal("expected at least one rendered MachineConfig document")
+	}
+
+	var machineConfig struct {
+		Spec struct {
+			Config struct {
+				Storage struct {
+					Files []struct {
+						Contents struct {
+							Source string `json:"source"`
+						} `json:"contents"`
+					} `json:"files"`
+				} `json:"storage"`
+			} `json:"config"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(docs[0], &machineConfig); err != nil {
+		t.Fatalf("failed to unmarshal rendered MachineConfig: %v", err)
+	}
+	if len(machineConfig.Spec.Config.Storage.Files) != 1 {
+		t.Fatalf("expected exactly one file in the rendered MachineConfig, got %d", len(machineConfig.Spec.Config.Storage.Files))
+	}
+
+	gotSource := machineConfig.Spec.Config.Storage.Files[0].Contents.Source
+	const wantPrefix = "data:;base64,"
+	if !strings.HasPrefix(gotSource, wantPrefix) {
+		t.Fatalf("rendered source = %q, want a %q-prefixed data URL", gotSource, wantPrefix)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(gotSource, wantPrefix))
+	if err != nil {
+		t.Fatalf("rendered source does not decode as base64: %v", err)
+	}
+	if string(decoded) != contents {
+		t.Errorf("decoded source = %q, want %q", decoded, contents)
+	}
+}
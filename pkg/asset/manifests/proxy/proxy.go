@@ -0,0 +1,83 @@
+// Package proxy renders the config.openshift.io/v1 Proxy manifest carrying
+// the cluster-wide proxy settings gathered during installconfig, so the
+// in-cluster proxy operator picks up the same settings applyProxy and
+// addProxyFiles already use to reach the cluster during install.
+package proxy
+
+import (
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+
+	"github.com/openshift/installer/pkg/asset"
+	"github.com/openshift/installer/pkg/asset/installconfig"
+	"github.com/openshift/installer/pkg/types"
+)
+
+const proxyFilename = "manifests/cluster-proxy-01-config.yaml"
+
+// Proxy generates the cluster-wide Proxy manifest.
+type Proxy struct {
+	FileList []*asset.File
+}
+
+var _ asset.WritableAsset = (*Proxy)(nil)
+
+// Dependencies returns all of the dependencies directly needed by a Proxy
+// asset.
+func (p *Proxy) Dependencies() []asset.Asset {
+	return []asset.Asset{
+		&installconfig.InstallConfig{},
+	}
+}
+
+// Generate generates the Proxy manifest, if a cluster-wide proxy was
+// configured.
+func (p *Proxy) Generate(parents asset.Parents) error {
+	installConfig := &installconfig.InstallConfig{}
+	parents.Get(installConfig)
+
+	if installConfig.Config.Proxy == nil {
+		return nil
+	}
+
+	data, err := renderProxy(installConfig.Config.Proxy)
+	if err != nil {
+		return errors.Wrap(err, "failed to render Proxy manifest")
+	}
+	p.FileList = []*asset.File{{Filename: proxyFilename, Data: data}}
+
+	return nil
+}
+
+// Name returns the human-friendly name of the asset.
+func (p *Proxy) Name() string {
+	return "Proxy Config"
+}
+
+// Files returns the files generated by the asset.
+func (p *Proxy) Files() []*asset.File {
+	return p.FileList
+}
+
+// Load returns false because this asset is always generated, never loaded
+// from disk.
+func (p *Proxy) Load(asset.FileFetcher) (bool, error) {
+	return false, nil
+}
+
+func renderProxy(config *types.Proxy) ([]byte, error) {
+	proxy := map[string]interface{}{
+		"apiVersion": "config.openshift.io/v1",
+		"kind":       "Proxy",
+		"metadata": map[string]string{
+			"name": "cluster",
+		},
+		"spec": map[string]interface{}{
+			"httpProxy":  config.HTTPProxy,
+			"httpsProxy": config.HTTPSProxy,
+			"noProxy":    config.NoProxy,
+		},
+	}
+
+	return yaml.Marshal(proxy)
+}
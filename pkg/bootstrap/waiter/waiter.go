@@ -0,0 +1,208 @@
+// Package waiter defines the steps `create cluster` waits through between
+// bringing up the bootstrap node and tearing it down: the API coming up,
+// the bootstrap-complete signal, and (new) every core ClusterOperator
+// reporting healthy. The logic used to live inline in destroyBootstrap;
+// it is now pluggable so alternate waiters (e.g. for testing, or for the
+// cluster-api install path) can be substituted.
+package waiter
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	watchtools "k8s.io/client-go/tools/watch"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+)
+
+// Waiter is the set of stages `create cluster` blocks on between the
+// bootstrap node coming up and being torn down.
+type Waiter interface {
+	// WaitForAPI blocks until the cluster's Kubernetes API is reachable.
+	WaitForAPI(ctx context.Context, config *rest.Config) error
+	// WaitForBootstrapComplete blocks until bootkube emits the
+	// bootstrap-complete event in kube-system.
+	WaitForBootstrapComplete(ctx context.Context, config *rest.Config) error
+	// WaitForClusterOperators blocks until every core ClusterOperator
+	// reports Available=True, Progressing=False, Degraded=False.
+	WaitForClusterOperators(ctx context.Context, config *rest.Config) error
+}
+
+// defaultWaiter is the Waiter used by `create cluster` outside of tests.
+type defaultWaiter struct{}
+
+// New returns the default Waiter implementation.
+func New() Waiter {
+	return &defaultWaiter{}
+}
+
+func (w *defaultWaiter) WaitForAPI(ctx context.Context, config *rest.Config) error {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating a Kubernetes client")
+	}
+	discovery := client.Discovery()
+
+	apiTimeout := 30 * time.Minute
+	logrus.Infof("Waiting %v for the Kubernetes API...", apiTimeout)
+	apiContext, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+	// Poll quickly so we notice changes, but only log when the response
+	// changes (because that's interesting) or when we've seen 15 of the
+	// same errors in a row (to show we're still alive).
+	logDownsample := 15
+	silenceRemaining := logDownsample
+	previousErrorSuffix := ""
+	wait.Until(func() {
+		version, err := discovery.ServerVersion()
+		if err == nil {
+			logrus.Infof("API %s up", version)
+			cancel()
+		} else {
+			silenceRemaining--
+			chunks := strings.Split(err.Error(), ":")
+			errorSuffix := chunks[len(chunks)-1]
+			if previousErrorSuffix != errorSuffix {
+				logrus.Debugf("Still waiting for the Kubernetes API: %v", err)
+				previousErrorSuffix = errorSuffix
+				silenceRemaining = logDownsample
+			} else if silenceRemaining == 0 {
+				logrus.Debugf("Still waiting for the Kubernetes API: %v", err)
+				silenceRemaining = logDownsample
+			}
+		}
+	}, 2*time.Second, apiContext.Done())
+
+	if err := apiContext.Err(); err != nil && err != context.Canceled {
+		return errors.Wrap(err, "waiting for the Kubernetes API")
+	}
+	return nil
+}
+
+func (w *defaultWaiter) WaitForBootstrapComplete(ctx context.Context, config *rest.Config) error {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating a Kubernetes client")
+	}
+	events := client.CoreV1().Events("kube-system")
+
+	eventTimeout := 30 * time.Minute
+	logrus.Infof("Waiting %v for the bootstrap-complete event...", eventTimeout)
+	eventContext, cancel := context.WithTimeout(ctx, eventTimeout)
+	defer cancel()
+	_, err = watchtools.Until(
+		eventContext,
+		"",
+		&eventWatcher{ctx: eventContext, events: events},
+		func(watchEvent watch.Event) (bool, error) {
+			event, ok := watchEvent.Object.(*corev1.Event)
+			if !ok {
+				return false, nil
+			}
+
+			if watchEvent.Type == watch.Error {
+				logrus.Debugf("error %s: %s", event.Name, event.Message)
+				return false, nil
+			}
+
+			if watchEvent.Type != watch.Added {
+				return false, nil
+			}
+
+			logrus.Debugf("added %s: %s", event.Name, event.Message)
+			return event.Name == "bootstrap-complete", nil
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "waiting for bootstrap-complete")
+	}
+	return nil
+}
+
+func (w *defaultWaiter) WaitForClusterOperators(ctx context.Context, config *rest.Config) error {
+	client, err := configclient.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating a config client")
+	}
+
+	timeout := 30 * time.Minute
+	logrus.Infof("Waiting %v for the cluster operators to become ready...", timeout)
+	operatorsContext, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return wait.PollImmediateUntil(10*time.Second, func() (bool, error) {
+		operators, err := client.ConfigV1().ClusterOperators().List(metav1.ListOptions{})
+		if err != nil {
+			logrus.Debugf("failed to list cluster operators: %v", err)
+			return false, nil
+		}
+		if len(operators.Items) == 0 {
+			return false, nil
+		}
+		for _, operator := range operators.Items {
+			if !clusterOperatorReady(&operator) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, operatorsContext.Done())
+}
+
+func clusterOperatorReady(operator *configv1.ClusterOperator) bool {
+	want := map[configv1.ClusterStatusConditionType]configv1.ConditionStatus{
+		configv1.OperatorAvailable:   configv1.ConditionTrue,
+		configv1.OperatorProgressing: configv1.ConditionFalse,
+		configv1.OperatorDegraded:    configv1.ConditionFalse,
+	}
+	found := make(map[configv1.ClusterStatusConditionType]bool, len(want))
+	for _, condition := range operator.Status.Conditions {
+		if status, ok := want[condition.Type]; ok {
+			if condition.Status != status {
+				return false
+			}
+			found[condition.Type] = true
+		}
+	}
+	// A ClusterOperator that hasn't reported a condition yet (e.g. it was
+	// just listed for the first time) must not be mistaken for a ready one.
+	return len(found) == len(want)
+}
+
+// eventWatcher adapts corev1.EventInterface.Watch to the watchtools.RetryWatcher
+// watcher-function signature used by watchtools.Until. It retries on
+// transient watch-connection failures (e.g. the apiserver isn't reachable
+// yet) instead of surfacing the first error, sleeping between attempts
+// until ctx expires.
+type eventWatcher struct {
+	ctx    context.Context
+	events interface {
+		Watch(options metav1.ListOptions) (watch.Interface, error)
+	}
+}
+
+func (e *eventWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	for {
+		watcher, err := e.events.Watch(options)
+		if err == nil {
+			return watcher, nil
+		}
+
+		select {
+		case <-e.ctx.Done():
+			return nil, err
+		default:
+			logrus.Warningf("Failed to connect events watcher, retrying: %v", err)
+			time.Sleep(2 * time.Second)
+		}
+	}
+}
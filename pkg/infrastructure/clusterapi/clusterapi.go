@@ -0,0 +1,333 @@
+// Package clusterapi implements the Cluster API–based infrastructure
+// provisioning backend selected by `create cluster --infrastructure=capi`.
+// It stands up an in-process Cluster API management cluster ("envtest-lite"),
+// applies Cluster/Machine/InfraCluster/InfraMachine manifests to it, and
+// waits for the resulting infrastructure and control-plane machines to
+// become ready, as an alternative to the Terraform-based driver.
+package clusterapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	awscontrollers "sigs.k8s.io/cluster-api-provider-aws/v2/controllers"
+	openstackcontrollers "sigs.k8s.io/cluster-api-provider-openstack/controllers"
+	capiv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capicontrollers "sigs.k8s.io/cluster-api/controllers"
+	capikubeconfig "sigs.k8s.io/cluster-api/util/kubeconfig"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	capimanifests "github.com/openshift/installer/pkg/asset/manifests/clusterapi"
+	installtypes "github.com/openshift/installer/pkg/types"
+)
+
+// StateDir is the subdirectory of the install directory that New creates
+// and reads the Cluster API CRDs from (under its crd subdirectory). The
+// management cluster's apiserver and etcd state is not kept there, so a
+// later `destroy cluster` cannot reattach to the management cluster.
+const StateDir = ".clusterapi_output"
+
+// pollInterval and the timeouts below mirror the ones destroyBootstrap
+// already uses for the Terraform-driven install path.
+const (
+	pollInterval          = 10 * time.Second
+	infrastructureTimeout = 30 * time.Minute
+	controlPlaneTimeout   = 30 * time.Minute
+)
+
+// capiNamespace is the namespace Apply creates every Cluster API object
+// in; it must match capimanifests.capiNamespace, since this package only
+// ever talks to the objects that package rendered.
+const capiNamespace = "openshift-cluster-api-install"
+
+// Provisioner drives cluster creation using an in-process Cluster API
+// management cluster instead of shelling out to Terraform.
+type Provisioner struct {
+	dir     string
+	config  *installtypes.InstallConfig
+	client  client.Client
+	cancel  context.CancelFunc
+	testEnv *envtest.Environment
+}
+
+// New stands up an in-process "envtest-lite" Cluster API management
+// cluster (a real, ephemeral kube-apiserver + etcd, per
+// sigs.k8s.io/controller-runtime/pkg/envtest) scoped to the platform
+// selected in the install config, and returns a Provisioner ready to
+// apply manifests to it and wait on the resulting infrastructure.
+func New(ctx context.Context, dir string, config *installtypes.InstallConfig) (*Provisioner, error) {
+	if err := os.MkdirAll(filepath.Join(dir, StateDir), 0750); err != nil {
+		return nil, errors.Wrap(err, "creating cluster-api state directory")
+	}
+
+	platform := capimanifests.PlatformName(config)
+	if platform == "" {
+		return nil, errors.New("no cluster-api infrastructure provider for this platform")
+	}
+
+	// Cluster API's and each provider's CRDs must be discoverable on disk
+	// for envtest to install them into the ephemeral apiserver; nothing in
+	// this codebase vendors or writes them, so the operator must place them
+	// under this path by hand before using --infrastructure=capi. That's
+	// also why cmd/openshift-install hides the --infrastructure flag from
+	// --help rather than presenting capi as a ready-to-use backend. Fail
+	// fast with a clear error here rather than letting envtest silently
+	// start an apiserver that has never heard of Cluster/Machine/
+	// InfraCluster and watching Apply fail against it later with a
+	// confusing error.
+	crdDir := filepath.Join(dir, StateDir, "crd")
+	if entries, err := os.ReadDir(crdDir); err != nil || len(entries) == 0 {
+		return nil, errors.Errorf("no cluster-api CRDs found in %s; vendor the Cluster API core and %s provider CRDs there before using --infrastructure=capi", crdDir, platform)
+	}
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:        []string{crdDir},
+		ErrorIfCRDPathMissing:    true,
+		ControlPlaneStartTimeout: 2 * time.Minute,
+	}
+	restConfig, err := testEnv.Start()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting envtest-lite cluster-api management cluster")
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		MetricsBindAddress: "0",
+		LeaderElection:     false,
+	})
+	if err != nil {
+		_ = testEnv.Stop()
+		return nil, errors.Wrap(err, "starting cluster-api manager")
+	}
+	if err := registerCoreControllers(mgr); err != nil {
+		_ = testEnv.Stop()
+		return nil, errors.Wrap(err, "registering core cluster-api controllers")
+	}
+	if err := registerProvider(mgr, platform); err != nil {
+		_ = testEnv.Stop()
+		return nil, errors.Wrapf(err, "registering %s infrastructure provider", platform)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-signals.SetupSignalHandler().Done()
+		logrus.Info("Shutting down the cluster-api management cluster...")
+		cancel()
+	}()
+	go func() {
+		if err := mgr.Start(ctx); err != nil && ctx.Err() == nil {
+			logrus.Errorf("cluster-api management cluster exited: %v", err)
+		}
+	}()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		cancel()
+		_ = testEnv.Stop()
+		return nil, errors.New("timed out waiting for cluster-api manager cache to sync")
+	}
+
+	// Apply creates every Cluster/Machine/InfraCluster/InfraMachine object in
+	// capiNamespace, but envtest-lite starts with nothing but the
+	// kube-system/default namespaces. Create it here, once, rather than
+	// leaving Apply's first Create to fail against a namespace nothing ever
+	// provisioned.
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: capiNamespace}}
+	if err := mgr.GetClient().Create(ctx, namespace); err != nil && !apierrors.IsAlreadyExists(err) {
+		cancel()
+		_ = testEnv.Stop()
+		return nil, errors.Wrapf(err, "creating %s namespace", capiNamespace)
+	}
+
+	return &Provisioner{dir: dir, config: config, client: mgr.GetClient(), cancel: cancel, testEnv: testEnv}, nil
+}
+
+// Close shuts down the management cluster, including its envtest-lite
+// apiserver and etcd. It does not delete any of the infrastructure the
+// management cluster created.
+func (p *Provisioner) Close() {
+	p.cancel()
+	if err := p.testEnv.Stop(); err != nil {
+		logrus.Warningf("failed to stop the cluster-api management cluster cleanly: %v", err)
+	}
+}
+
+// Apply renders the Cluster, Machine, and provider-specific
+// InfraCluster/InfraMachine objects for the install config and creates them
+// on the management cluster.
+func (p *Provisioner) Apply(ctx context.Context) error {
+	infraCluster, err := capimanifests.InfraCluster(p.config)
+	if err != nil {
+		return errors.Wrap(err, "rendering infrastructure cluster manifest")
+	}
+	if err := p.client.Create(ctx, infraCluster); err != nil {
+		return errors.Wrap(err, "creating infrastructure cluster")
+	}
+
+	cluster, err := capimanifests.Cluster(p.config)
+	if err != nil {
+		return errors.Wrap(err, "rendering cluster manifest")
+	}
+	if err := p.client.Create(ctx, cluster); err != nil {
+		return errors.Wrap(err, "creating cluster")
+	}
+
+	machines, infraMachines, err := capimanifests.Machines(p.config)
+	if err != nil {
+		return errors.Wrap(err, "rendering machine manifests")
+	}
+	for _, infraMachine := range infraMachines {
+		if err := p.client.Create(ctx, infraMachine); err != nil {
+			return errors.Wrapf(err, "creating infrastructure machine %s", infraMachine.GetName())
+		}
+	}
+	for _, machine := range machines {
+		if err := p.client.Create(ctx, machine); err != nil {
+			return errors.Wrapf(err, "creating machine %s", machine.Name)
+		}
+	}
+
+	return nil
+}
+
+// WaitForInfrastructure blocks until the Cluster reports
+// status.infrastructureReady and every control-plane Machine reports a
+// Ready condition.
+func (p *Provisioner) WaitForInfrastructure(ctx context.Context) error {
+	key := types.NamespacedName{Name: p.config.ObjectMeta.Name, Namespace: capiNamespace}
+
+	logrus.Infof("Waiting up to %v for the cluster-api infrastructure to become ready...", infrastructureTimeout)
+	infraCtx, cancel := context.WithTimeout(ctx, infrastructureTimeout)
+	defer cancel()
+	if err := wait.PollImmediateUntil(pollInterval, func() (bool, error) {
+		cluster := &capiv1.Cluster{}
+		if err := p.client.Get(infraCtx, key, cluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return cluster.Status.InfrastructureReady, nil
+	}, infraCtx.Done()); err != nil {
+		return errors.Wrap(err, "waiting for cluster infrastructure to become ready")
+	}
+
+	logrus.Infof("Waiting up to %v for the control-plane machines to become ready...", controlPlaneTimeout)
+	cpCtx, cancel := context.WithTimeout(ctx, controlPlaneTimeout)
+	defer cancel()
+	return wait.PollImmediateUntil(pollInterval, func() (bool, error) {
+		machineList := &capiv1.MachineList{}
+		if err := p.client.List(cpCtx, machineList, client.InNamespace(capiNamespace),
+			client.MatchingLabels{"cluster.x-k8s.io/control-plane": ""}); err != nil {
+			return false, err
+		}
+		if len(machineList.Items) == 0 {
+			return false, nil
+		}
+		for _, machine := range machineList.Items {
+			if !isMachineReady(&machine) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, cpCtx.Done())
+}
+
+func isMachineReady(machine *capiv1.Machine) bool {
+	for _, condition := range machine.Status.Conditions {
+		if condition.Type == capiv1.ReadyCondition {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// WriteKubeconfig extracts the admin kubeconfig for the workload cluster
+// from the management cluster's generated secret and writes it to
+// <dir>/auth/kubeconfig, matching the layout the Terraform-driven path
+// produces via the kubeconfig.Admin asset.
+func (p *Provisioner) WriteKubeconfig(ctx context.Context) error {
+	data, err := capikubeconfig.FromSecret(ctx, p.client, types.NamespacedName{
+		Name:      p.config.ObjectMeta.Name,
+		Namespace: capiNamespace,
+	})
+	if err != nil {
+		return errors.Wrap(err, "fetching admin kubeconfig from cluster-api secret")
+	}
+
+	authDir := filepath.Join(p.dir, "auth")
+	if err := os.MkdirAll(authDir, 0750); err != nil {
+		return errors.Wrap(err, "creating auth directory")
+	}
+	if err := os.WriteFile(filepath.Join(authDir, "kubeconfig"), data, 0640); err != nil {
+		return errors.Wrap(err, "writing kubeconfig")
+	}
+	return nil
+}
+
+// registerCoreControllers wires up the core Cluster API controllers that
+// own Cluster/Machine reconciliation. Without these, nothing ever copies
+// an InfraCluster/InfraMachine's readiness up into
+// Cluster.status.infrastructureReady or the Machine Ready condition, and
+// WaitForInfrastructure would poll those fields forever no matter how
+// healthy the provider-specific controllers are.
+func registerCoreControllers(mgr ctrl.Manager) error {
+	if err := (&capicontrollers.ClusterReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+		return errors.Wrap(err, "setting up Cluster controller")
+	}
+	if err := (&capicontrollers.MachineReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+		return errors.Wrap(err, "setting up Machine controller")
+	}
+	return nil
+}
+
+// registerProvider wires up the controller-runtime manager with the
+// infrastructure provider controllers matching platform, so the
+// Cluster/Machine/InfraCluster/InfraMachine objects Apply creates actually
+// get reconciled into real infrastructure.
+func registerProvider(mgr ctrl.Manager, platform string) error {
+	switch platform {
+	case "aws":
+		if err := (&awscontrollers.AWSClusterReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+			return errors.Wrap(err, "setting up AWSCluster controller")
+		}
+		if err := (&awscontrollers.AWSMachineReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+			return errors.Wrap(err, "setting up AWSMachine controller")
+		}
+		return nil
+	case "openstack":
+		if err := (&openstackcontrollers.OpenStackClusterReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+			return errors.Wrap(err, "setting up OpenStackCluster controller")
+		}
+		if err := (&openstackcontrollers.OpenStackMachineReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr, controllerOptions); err != nil {
+			return errors.Wrap(err, "setting up OpenStackMachine controller")
+		}
+		return nil
+	case "libvirt":
+		// There is no maintained upstream Cluster API infrastructure
+		// provider for libvirt, unlike aws/openstack. Rather than silently
+		// accepting a platform we cannot actually reconcile, fail loudly so
+		// --infrastructure=capi never hangs waiting on a controller that
+		// will never run.
+		return errors.New("cluster-api infrastructure provider for libvirt is not available; use --infrastructure=terraform for libvirt installs")
+	default:
+		return errors.Errorf("unsupported cluster-api platform %q", platform)
+	}
+}
+
+// controllerOptions mirrors the zero-value defaults the provider
+// SetupWithManager methods expect; provided explicitly so a future bump to
+// one of those methods' signatures surfaces as a compile error here rather
+// than an implicit zero-value change.
+var controllerOptions = controller.Options{MaxConcurrentReconciles: 1}